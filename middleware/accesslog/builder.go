@@ -1,15 +1,30 @@
 package accesslog
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"github.com/gin-gonic/gin"
-	"io"
+	"math/rand"
+	"net"
+	"regexp"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/atomic"
 )
 
+// defaultSkipContentTypes 默认跳过body记录的Content-Type，
+// 这些类型要么是二进制内容，要么记录后也无法阅读
+var defaultSkipContentTypes = []string{
+	"multipart/*",
+	"application/octet-stream",
+	"image/*",
+	"video/*",
+}
+
 type AccessLog struct {
 	// HTTP请求方法, GET, POST, PUT, DELETE
 	Method string
@@ -22,7 +37,30 @@ type AccessLog struct {
 	// HTTP状态码
 	Status int
 	// 请求耗时
-	Duration string
+	Duration time.Duration
+	// 请求开始时间
+	StartTime time.Time
+	// 客户端IP
+	ClientIP string
+	// 客户端User-Agent
+	UserAgent string
+	// 请求的唯一标识，从RequestIDHeader读取，缺失时自动生成，用于跨服务关联日志
+	RequestID string
+	// 响应体大小（字节）
+	RespSize int
+	// Referer请求头
+	Referer string
+	// Fields 是下游handler通过WithField附加的自定义字段
+	Fields map[string]any
+	// TraceID/SpanID 在WithTracer启用时由本次请求的span写入，用于和链路追踪关联
+	TraceID string
+	SpanID  string
+	// ReqBodySize 是请求body的总字节数，不受MaxLength截断限制
+	ReqBodySize int64
+	// ReqBodySpillPath 在SpillToDisk启用且body超过阈值时指向落盘的临时文件，
+	// 此时ReqBody为空，完整内容需要从该路径读取。该文件不会自动删除，
+	// 消费完成后请调用RemoveSpillFile（或由独立的TTL清理程序）负责删除
+	ReqBodySpillPath string
 }
 
 type Builder struct {
@@ -35,14 +73,56 @@ type Builder struct {
 	loggerFunc func(ctx context.Context, al *AccessLog)
 
 	maxLength *atomic.Int64
+
+	// 是否对请求体和响应体按Content-Encoding解压后再记录
+	decodeContentEncoding *atomic.Bool
+
+	// redactor 在body记录前对其脱敏，nil表示不脱敏
+	mutex    sync.RWMutex
+	redactor Redactor
+	// skipContentTypes 命中的Content-Type不记录body
+	skipContentTypes []string
+	// skipPaths/skipPathsRegexp 命中的路径整条跳过日志记录
+	skipPaths        map[string]struct{}
+	skipPathsRegexps []*regexp.Regexp
+
+	// requestIDHeader 是请求ID的header名：从该header读取上游传入的请求ID，
+	// 缺失时自动生成，并写回响应的同名header供下游/客户端关联日志
+	requestIDHeader string
+	// sink 优先于loggerFunc使用的结构化输出目的地
+	sink Sink
+	// sampleRate 采样率，[0, 1]，1表示全部记录
+	sampleRate float64
+	// sampleFunc 优先于sampleRate的自定义采样函数
+	sampleFunc func(ctx *gin.Context) bool
+	// slowThreshold 耗时超过该阈值的请求总是记录，不受采样影响
+	slowThreshold time.Duration
+
+	// tracerProvider/tracer 在WithTracer配置后启用每请求的span
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+	// meterProvider及各项指标在WithMeter配置后启用
+	meterProvider     metric.MeterProvider
+	durationHistogram metric.Float64Histogram
+	reqSizeHistogram  metric.Int64Histogram
+	respSizeHistogram metric.Int64Histogram
+
+	// spillDir/spillThreshold 在SpillToDisk配置后，超过阈值的请求体会被写入该目录下的临时文件
+	spillDir       string
+	spillThreshold int64
 }
 
 func NewBuilder(fn func(ctx context.Context, al *AccessLog)) *Builder {
 	return &Builder{
-		loggerFunc:    fn,
-		allowReqBody:  atomic.NewBool(false),
-		allowRespBody: atomic.NewBool(false),
-		maxLength:     atomic.NewInt64(1024),
+		loggerFunc:            fn,
+		allowReqBody:          atomic.NewBool(false),
+		allowRespBody:         atomic.NewBool(false),
+		maxLength:             atomic.NewInt64(1024),
+		decodeContentEncoding: atomic.NewBool(false),
+		skipContentTypes:      append([]string(nil), defaultSkipContentTypes...),
+		skipPaths:             make(map[string]struct{}),
+		requestIDHeader:       "X-Request-Id",
+		sampleRate:            1,
 	}
 }
 
@@ -64,8 +144,161 @@ func (b *Builder) MaxLength(maxLength int64) *Builder {
 	return b
 }
 
+// SkipContentTypes 设置不记录body的Content-Type，支持"type/*"通配符，
+// 调用后会覆盖默认列表（multipart/*、application/octet-stream、image/*、video/*）
+func (b *Builder) SkipContentTypes(contentTypes ...string) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.skipContentTypes = contentTypes
+	return b
+}
+
+// DecodeContentEncoding 设置是否在记录前按Content-Encoding（gzip、deflate）解压body
+func (b *Builder) DecodeContentEncoding(ok bool) *Builder {
+	b.decodeContentEncoding.Store(ok)
+	return b
+}
+
+// Redactor 设置body记录前的脱敏函数，常用RedactJSONFields构造
+func (b *Builder) Redactor(redactor Redactor) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.redactor = redactor
+	return b
+}
+
+// SkipPaths 设置不记录日志的路径（精确匹配）
+func (b *Builder) SkipPaths(paths ...string) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, p := range paths {
+		b.skipPaths[p] = struct{}{}
+	}
+	return b
+}
+
+// SkipPathsRegexp 设置不记录日志的路径（正则匹配），正则编译失败时会直接panic
+func (b *Builder) SkipPathsRegexp(exprs ...string) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, expr := range exprs {
+		b.skipPathsRegexps = append(b.skipPathsRegexps, regexp.MustCompile(expr))
+	}
+	return b
+}
+
+// RequestIDHeader 设置请求ID的header名，默认X-Request-Id：请求到来时从该header读取，
+// 缺失时自动生成，并在响应时写回同名header
+func (b *Builder) RequestIDHeader(header string) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.requestIDHeader = header
+	return b
+}
+
+// Sink 设置结构化日志的输出目的地，设置后优先于NewBuilder传入的loggerFunc
+func (b *Builder) Sink(sink Sink) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sink = sink
+	return b
+}
+
+// Sample 设置采样率，rate取值范围[0, 1]，1表示全部记录、0表示仅记录5xx和慢请求
+func (b *Builder) Sample(rate float64) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sampleRate = rate
+	return b
+}
+
+// SampleFunc 设置自定义采样函数，返回true才记录，设置后优先于Sample
+func (b *Builder) SampleFunc(fn func(ctx *gin.Context) bool) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sampleFunc = fn
+	return b
+}
+
+// SlowThreshold 设置慢请求阈值，耗时超过该阈值的请求不受采样影响，始终记录
+func (b *Builder) SlowThreshold(d time.Duration) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.slowThreshold = d
+	return b
+}
+
+// SpillToDisk 设置超过threshold字节的请求体落盘到dir目录下的临时文件，
+// 而不是留在内存里，AccessLog只保存文件路径和大小。该文件不会随请求结束自动删除，
+// 因为Sink/loggerFunc可能是异步消费的，删除时机交给调用方，见RemoveSpillFile
+func (b *Builder) SpillToDisk(dir string, threshold int64) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.spillDir = dir
+	b.spillThreshold = threshold
+	return b
+}
+
+// shouldLog 判断该请求是否应当被记录：5xx和慢请求总是记录，其余走采样
+func (b *Builder) shouldLog(ctx *gin.Context, al *AccessLog) bool {
+	if al.Status >= 500 {
+		return true
+	}
+	b.mutex.RLock()
+	sampleFunc := b.sampleFunc
+	sampleRate := b.sampleRate
+	slowThreshold := b.slowThreshold
+	b.mutex.RUnlock()
+	if slowThreshold > 0 && al.Duration >= slowThreshold {
+		return true
+	}
+	if sampleFunc != nil {
+		return sampleFunc(ctx)
+	}
+	if sampleRate >= 1 {
+		return true
+	}
+	if sampleRate <= 0 {
+		return false
+	}
+	return rand.Float64() < sampleRate
+}
+
+// shouldSkipPath 判断该请求路径是否应当完全跳过日志记录
+func (b *Builder) shouldSkipPath(path string) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if _, ok := b.skipPaths[path]; ok {
+		return true
+	}
+	for _, re := range b.skipPathsRegexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldSkipContentType 判断该Content-Type是否应当跳过body记录
+func (b *Builder) shouldSkipContentType(contentType string) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, pattern := range b.skipContentTypes {
+		if matchContentType(pattern, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *Builder) Builder() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		// 命中跳过路径（如健康检查、metrics）时完全不记录日志
+		if b.shouldSkipPath(ctx.Request.URL.Path) {
+			ctx.Next()
+			return
+		}
+
 		var (
 			// 记录请求开始时间
 			start = time.Now()
@@ -79,41 +312,107 @@ func (b *Builder) Builder() gin.HandlerFunc {
 			allowReqBody = b.allowReqBody.Load()
 			// 是否打印响应体
 			allowRespBody = b.allowRespBody.Load()
+			// 请求的Content-Type，决定是否需要跳过body记录
+			reqContentType = ctx.GetHeader("Content-Type")
 		)
 		// 如果url长度超过最大长度，截取0-maxLength位置
 		if curLen > maxLength {
 			url = url[:maxLength]
 		}
 
+		b.mutex.RLock()
+		requestIDHeader := b.requestIDHeader
+		b.mutex.RUnlock()
+		requestID := ctx.GetHeader(requestIDHeader)
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+		// 自动生成的requestID只存在于本次请求里，写回响应头后下游（网关、前端、
+		// 下一跳的服务）才能拿到同一个ID去关联日志，不写回的话跨服务关联只对
+		// 主动传了该header的调用方生效
+		ctx.Writer.Header().Set(requestIDHeader, requestID)
+
 		accessLog := &AccessLog{
-			Method: ctx.Request.Method,
-			URL:    url,
+			Method:    ctx.Request.Method,
+			URL:       url,
+			StartTime: start,
+			ClientIP:  ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+			Referer:   ctx.Request.Referer(),
+			RequestID: requestID,
 		}
+		// 挂载到gin.Context上，供下游handler通过WithField附加自定义字段
+		ctx.Set(accessLogCtxKey, accessLog)
 
-		// 记录请求体
-		if ctx.Request.Body != nil && allowReqBody {
-			// 读取body
-			body, _ := ctx.GetRawData()
-			// 读取完body后，需要重新写入
-			ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
-			// 如果body长度超过最大长度，截取0-maxLength位置
-			if int64(len(body)) > maxLength {
-				body = body[:maxLength]
-			}
-			// 注意资源的消耗
-			accessLog.ReqBody = string(body)
+		// route使用FullPath而不是原始URL，避免带参数的路径（如/user/123）造成高基数
+		route := ctx.FullPath()
+		span := b.startSpan(ctx, route)
+
+		// 记录请求体：用teeReadCloser包装Body，边读边捕获，避免在handler读取之前
+		// 把整个body都载入内存（对大文件上传尤其重要）
+		var tee *teeReadCloser
+		reqContentEncoding := ctx.GetHeader("Content-Encoding")
+		if ctx.Request.Body != nil && allowReqBody && !b.shouldSkipContentType(reqContentType) {
+			b.mutex.RLock()
+			spillDir, spillThreshold := b.spillDir, b.spillThreshold
+			b.mutex.RUnlock()
+			tee = newTeeReadCloser(ctx.Request.Body, maxLength, b.decodeContentEncoding, spillDir, spillThreshold)
+			ctx.Request.Body = tee
 		}
+		// ReqBodySize默认取自Content-Length头，这样即便AllowReqBody关闭（不安装tee）
+		// 或该Content-Type被跳过，WithMeter上报的http.server.request.size也不会恒为0；
+		// tee存在时，finalize会用实际读取到的字节数覆盖这个估算值
+		if cl := ctx.Request.ContentLength; cl > 0 {
+			accessLog.ReqBodySize = cl
+		}
+		var respWriter *responseWriter
 		if allowRespBody {
-			ctx.Writer = responseWriter{
+			b.mutex.RLock()
+			spillThreshold := b.spillThreshold
+			b.mutex.RUnlock()
+			respWriter = &responseWriter{
 				ResponseWriter: ctx.Writer,
 				al:             accessLog,
 				maxLength:      maxLength,
+				decodeCap:      capLength(maxLength, spillThreshold),
+				builder:        b,
 			}
+			ctx.Writer = respWriter
 		}
 		defer func() {
-			accessLog.Duration = time.Since(start).String()
-			// 日志打印
-			b.loggerFunc(ctx, accessLog)
+			accessLog.Duration = time.Since(start)
+			// Status/RespSize由gin.ResponseWriter自身无条件维护，不依赖AllowRespBody
+			// 是否开启了responseWriter包装，否则未开启响应体捕获时这两个字段永远是零值
+			accessLog.Status = ctx.Writer.Status()
+			// gin在尚未写出任何字节时Size()返回-1，此时RespSize保持为0
+			if size := ctx.Writer.Size(); size > 0 {
+				accessLog.RespSize = size
+			}
+			// 在最终确定前，把累计到buffer里的响应体落盘到AccessLog上
+			if respWriter != nil {
+				respWriter.flush()
+			}
+			// 此时handler已经读完（或放弃读取）请求body，可以安全地把捕获结果落盘到AccessLog。
+			// 注意：落盘的spill文件不会在这里删除——它的存在意义就是供Sink/loggerFunc之后
+			// 异步读取完整body，删除请求应由消费方或单独的TTL清理程序负责，见RemoveSpillFile
+			if tee != nil {
+				tee.finalize(b, reqContentType, reqContentEncoding, accessLog)
+			}
+			b.endSpan(span, accessLog)
+			b.recordMetrics(ctx, route, accessLog)
+			if !b.shouldLog(ctx, accessLog) {
+				return
+			}
+			b.mutex.RLock()
+			sink := b.sink
+			b.mutex.RUnlock()
+			if sink != nil {
+				_ = sink.Write(ctx, accessLog)
+				return
+			}
+			if b.loggerFunc != nil {
+				b.loggerFunc(ctx, accessLog)
+			}
 		}()
 
 		// 执行下一个中间件
@@ -122,22 +421,77 @@ func (b *Builder) Builder() gin.HandlerFunc {
 	}
 }
 
-// responseWriter 重写gin.ResponseWriter的Write方法，用于记录响应体
+// redact 在redactor存在时对body进行脱敏，否则原样返回
+func (b *Builder) redact(contentType string, body []byte) []byte {
+	b.mutex.RLock()
+	redactor := b.redactor
+	b.mutex.RUnlock()
+	if redactor == nil {
+		return body
+	}
+	return redactor(contentType, body)
+}
+
+// responseWriter 包装gin.ResponseWriter，把发给客户端的响应体原样转发，
+// 同时把最多maxLength字节累加进内部buffer，供中间件在请求结束后记录到AccessLog.RespBody上。
+// Status/RespSize由gin.ResponseWriter自身无条件维护，这里不重复记录，
+// 使用指针接收者，因为buf需要跨多次Write调用累积状态。
 type responseWriter struct {
 	gin.ResponseWriter
 	al        *AccessLog
 	maxLength int64
+	decodeCap int64
+	builder   *Builder
+	buf       bytes.Buffer
 }
 
-func (r responseWriter) WriteHeader(statusCode int) {
-	r.al.Status = statusCode
-	r.ResponseWriter.WriteHeader(statusCode)
-}
-func (r responseWriter) Write(data []byte) (int, error) {
-	curLen := int64(len(data))
-	if curLen >= r.maxLength {
-		data = data[:r.maxLength]
+// Write 把data原样转发给底层ResponseWriter，不做任何截断。
+// 捕获进r.buf的字节在DecodeContentEncoding关闭时按maxLength截断即可；开启时按decodeCap
+// （maxLength和spillThreshold中较大者）截断——这样即使响应体是一个超大的压缩流，
+// r.buf也不会无限增长，代价是截断点落在压缩数据中间时预览可能解不出完整内容
+func (r *responseWriter) Write(data []byte) (int, error) {
+	limit := r.maxLength
+	if r.builder.decodeContentEncoding.Load() {
+		limit = r.decodeCap
+	}
+	if int64(r.buf.Len()) < limit {
+		remain := limit - int64(r.buf.Len())
+		if remain > int64(len(data)) {
+			remain = int64(len(data))
+		}
+		r.buf.Write(data[:remain])
 	}
-	r.al.RespBody = string(data)
 	return r.ResponseWriter.Write(data)
 }
+
+// flush 把buf中累积的响应体落盘到AccessLog.RespBody：先解压、再截断到maxLength、最后脱敏，
+// 在中间件的deferred块里调用，此时后续Write已经不会再发生
+func (r *responseWriter) flush() {
+	respContentType := r.Header().Get("Content-Type")
+	if r.builder.shouldSkipContentType(respContentType) {
+		return
+	}
+	body := r.buf.Bytes()
+	if r.builder.decodeContentEncoding.Load() {
+		body = decodeContentEncoding(r.Header().Get("Content-Encoding"), body)
+	}
+	if int64(len(body)) > r.maxLength {
+		body = body[:r.maxLength]
+	}
+	r.al.RespBody = string(r.builder.redact(respContentType, body))
+}
+
+// Flush 透传给底层ResponseWriter，保证流式响应在AllowRespBody开启时仍能正常刷新
+func (r *responseWriter) Flush() {
+	r.ResponseWriter.Flush()
+}
+
+// Hijack 透传给底层ResponseWriter，保证websocket等协议升级在AllowRespBody开启时仍能正常工作
+func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.ResponseWriter.Hijack()
+}
+
+// CloseNotify 透传给底层ResponseWriter，兼容依赖http.CloseNotifier的老代码
+func (r *responseWriter) CloseNotify() <-chan bool {
+	return r.ResponseWriter.CloseNotify()
+}
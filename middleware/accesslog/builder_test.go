@@ -0,0 +1,175 @@
+package accesslog
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestGinContext() *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	return ctx
+}
+
+func TestShouldLogAlwaysLogs5xx(t *testing.T) {
+	b := NewBuilder(nil).Sample(0)
+	al := &AccessLog{Status: 500}
+	if !b.shouldLog(newTestGinContext(), al) {
+		t.Error("5xx responses must always be logged regardless of sampling")
+	}
+}
+
+func TestShouldLogAlwaysLogsSlowRequests(t *testing.T) {
+	b := NewBuilder(nil).Sample(0).SlowThreshold(100 * time.Millisecond)
+	al := &AccessLog{Status: 200, Duration: 200 * time.Millisecond}
+	if !b.shouldLog(newTestGinContext(), al) {
+		t.Error("requests slower than SlowThreshold must always be logged regardless of sampling")
+	}
+}
+
+func TestShouldLogSampleFuncTakesPrecedenceOverSampleRate(t *testing.T) {
+	b := NewBuilder(nil).Sample(0).SampleFunc(func(*gin.Context) bool { return true })
+	al := &AccessLog{Status: 200}
+	if !b.shouldLog(newTestGinContext(), al) {
+		t.Error("SampleFunc returning true should override a Sample rate of 0")
+	}
+
+	b2 := NewBuilder(nil).Sample(1).SampleFunc(func(*gin.Context) bool { return false })
+	if b2.shouldLog(newTestGinContext(), al) {
+		t.Error("SampleFunc returning false should override a Sample rate of 1")
+	}
+}
+
+func TestShouldLogSampleRateBoundaries(t *testing.T) {
+	al := &AccessLog{Status: 200}
+
+	allIn := NewBuilder(nil).Sample(1)
+	for i := 0; i < 10; i++ {
+		if !allIn.shouldLog(newTestGinContext(), al) {
+			t.Fatal("Sample(1) should always log")
+		}
+	}
+
+	allOut := NewBuilder(nil).Sample(0)
+	for i := 0; i < 10; i++ {
+		if allOut.shouldLog(newTestGinContext(), al) {
+			t.Fatal("Sample(0) should never log a healthy, fast request")
+		}
+	}
+}
+
+func TestAsyncSinkDropsWhenBufferFull(t *testing.T) {
+	block := make(chan struct{})
+	inner := sinkFunc(func(ctx context.Context, al *AccessLog) error {
+		<-block
+		return nil
+	})
+	async := NewAsyncSink(inner, 1)
+	defer close(block)
+
+	// 第一条会被inner的goroutine立刻取走并卡在block上，
+	// 后面的请求会把channel填满直到丢弃计数增加
+	for i := 0; i < 10; i++ {
+		_ = async.Write(context.Background(), &AccessLog{})
+	}
+
+	if async.Dropped() == 0 {
+		t.Error("expected AsyncSink to drop at least one entry once its buffer filled up")
+	}
+}
+
+func TestResponseWriterDecodeContentEncodingBoundsBuffer(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	b := NewBuilder(nil).DecodeContentEncoding(true).SpillToDisk(t.TempDir(), 50)
+	rw := &responseWriter{
+		ResponseWriter: ctx.Writer,
+		al:             &AccessLog{},
+		maxLength:      10,
+		decodeCap:      capLength(10, 50),
+		builder:        b,
+	}
+
+	if _, err := rw.Write([]byte(strings.Repeat("f", 1000))); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if rw.buf.Len() > 50 {
+		t.Errorf("buf.Len() = %d, want capped at max(maxLength, spillThreshold) = 50 even with DecodeContentEncoding on", rw.buf.Len())
+	}
+}
+
+func TestReqBodySizeFallsBackToContentLengthWhenBodyNotCaptured(t *testing.T) {
+	var captured *AccessLog
+	b := NewBuilder(nil).Sink(sinkFunc(func(ctx context.Context, al *AccessLog) error {
+		captured = al
+		return nil
+	}))
+	router := gin.New()
+	router.Use(b.Builder())
+	router.POST("/", func(ctx *gin.Context) {
+		_, _ = io.Copy(io.Discard, ctx.Request.Body)
+		ctx.Status(200)
+	})
+
+	body := strings.Repeat("x", 42)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if captured == nil {
+		t.Fatal("expected sink to be called")
+	}
+	if captured.ReqBodySize != int64(len(body)) {
+		t.Errorf("ReqBodySize = %d, want %d from Content-Length (AllowReqBody was never enabled, so no tee is installed)", captured.ReqBodySize, len(body))
+	}
+}
+
+func TestRequestIDIsWrittenBackToResponseHeaderAndRetrievableFromContext(t *testing.T) {
+	var gotFromHandler string
+	b := NewBuilder(nil)
+	router := gin.New()
+	router.Use(b.Builder())
+	router.GET("/", func(ctx *gin.Context) {
+		gotFromHandler = RequestID(ctx)
+		ctx.Status(200)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if gotFromHandler != "abc-123" {
+		t.Errorf("RequestID(ctx) inside handler = %q, want %q", gotFromHandler, "abc-123")
+	}
+	if got := w.Header().Get("X-Request-Id"); got != "abc-123" {
+		t.Errorf("response header X-Request-Id = %q, want the same id %q echoed back", got, "abc-123")
+	}
+}
+
+func TestAutoGeneratedRequestIDIsWrittenBackToResponseHeader(t *testing.T) {
+	b := NewBuilder(nil)
+	router := gin.New()
+	router.Use(b.Builder())
+	router.GET("/", func(ctx *gin.Context) { ctx.Status(200) })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-Id"); got == "" {
+		t.Error("expected an auto-generated request id to be written back to the response header")
+	}
+}
+
+type sinkFunc func(ctx context.Context, al *AccessLog) error
+
+func (f sinkFunc) Write(ctx context.Context, al *AccessLog) error {
+	return f(ctx, al)
+}
@@ -0,0 +1,31 @@
+package accesslog
+
+import "context"
+
+// accessLogCtxKey 是AccessLog挂载在gin.Context上的key，
+// 使用字符串类型是为了兼容gin.Context.Value对c.Keys的查找
+const accessLogCtxKey = "ginx-accesslog-entry"
+
+// WithField 从下游handler中为当前请求的AccessLog附加一个自定义字段，
+// ctx通常是*gin.Context，未找到AccessLog时（例如中间件未注册）该调用是no-op
+func WithField(ctx context.Context, key string, value any) {
+	al, ok := ctx.Value(accessLogCtxKey).(*AccessLog)
+	if !ok {
+		return
+	}
+	if al.Fields == nil {
+		al.Fields = make(map[string]any)
+	}
+	al.Fields[key] = value
+}
+
+// RequestID 返回当前请求的请求ID（上游传入或中间件自动生成的），
+// ctx通常是*gin.Context，未找到AccessLog时（例如中间件未注册）返回空字符串。
+// 下游handler可以用它把同一个ID透传给自己发起的下游调用，实现跨服务关联
+func RequestID(ctx context.Context) string {
+	al, ok := ctx.Value(accessLogCtxKey).(*AccessLog)
+	if !ok {
+		return ""
+	}
+	return al.RequestID
+}
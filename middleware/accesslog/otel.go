@@ -0,0 +1,115 @@
+package accesslog
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 是该中间件上报span/metric时使用的instrumentation scope名
+const instrumentationName = "github.com/cancan927/ginx/middleware/accesslog"
+
+// otelPropagator 用于从请求头中提取W3C traceparent/tracestate，使本次span能关联到上游trace
+var otelPropagator = propagation.TraceContext{}
+
+// WithTracer 启用链路追踪：每个请求会在tp上开启一个名为"HTTP {method} {route}"的span，
+// 并把ReqBody/RespBody（已经过脱敏/跳过规则处理）记录为span event，TraceID/SpanID会写回AccessLog
+func (b *Builder) WithTracer(tp trace.TracerProvider) *Builder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tracerProvider = tp
+	b.tracer = tp.Tracer(instrumentationName)
+	return b
+}
+
+// WithMeter 启用指标上报：为每个请求记录http.server.duration、
+// http.server.request.size、http.server.response.size三个指标，维度为{method, route, status_code}
+func (b *Builder) WithMeter(mp metric.MeterProvider) *Builder {
+	meter := mp.Meter(instrumentationName)
+	durationHist, _ := meter.Float64Histogram(
+		"http.server.duration",
+		metric.WithDescription("请求耗时"),
+		metric.WithUnit("ms"),
+	)
+	reqSizeHist, _ := meter.Int64Histogram(
+		"http.server.request.size",
+		metric.WithDescription("请求体大小"),
+		metric.WithUnit("By"),
+	)
+	respSizeHist, _ := meter.Int64Histogram(
+		"http.server.response.size",
+		metric.WithDescription("响应体大小"),
+		metric.WithUnit("By"),
+	)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.meterProvider = mp
+	b.durationHistogram = durationHist
+	b.reqSizeHistogram = reqSizeHist
+	b.respSizeHistogram = respSizeHist
+	return b
+}
+
+// startSpan 在配置了WithTracer时为当前请求开启span，并把span上下文注入ctx.Request，
+// 未配置tracer时返回nil
+func (b *Builder) startSpan(ctx *gin.Context, route string) trace.Span {
+	b.mutex.RLock()
+	tracer := b.tracer
+	b.mutex.RUnlock()
+	if tracer == nil {
+		return nil
+	}
+	parentCtx := otelPropagator.Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+	spanCtx, span := tracer.Start(parentCtx, fmt.Sprintf("HTTP %s %s", ctx.Request.Method, route),
+		trace.WithSpanKind(trace.SpanKindServer))
+	ctx.Request = ctx.Request.WithContext(spanCtx)
+	return span
+}
+
+// endSpan 把AccessLog中已经计算好的字段（状态码、body等）记录到span上并结束span
+func (b *Builder) endSpan(span trace.Span, al *AccessLog) {
+	if span == nil {
+		return
+	}
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int("http.status_code", al.Status),
+		attribute.Int64("http.request_content_length", al.ReqBodySize),
+		attribute.Int("http.response_content_length", al.RespSize),
+		attribute.String("net.peer.ip", al.ClientIP),
+	)
+	if al.ReqBody != "" {
+		span.AddEvent("request body", trace.WithAttributes(attribute.String("body", al.ReqBody)))
+	}
+	if al.RespBody != "" {
+		span.AddEvent("response body", trace.WithAttributes(attribute.String("body", al.RespBody)))
+	}
+	sc := span.SpanContext()
+	al.TraceID = sc.TraceID().String()
+	al.SpanID = sc.SpanID().String()
+}
+
+// recordMetrics 在配置了WithMeter时上报本次请求的耗时与收发大小
+func (b *Builder) recordMetrics(ctx *gin.Context, route string, al *AccessLog) {
+	b.mutex.RLock()
+	durationHist := b.durationHistogram
+	reqSizeHist := b.reqSizeHistogram
+	respSizeHist := b.respSizeHistogram
+	b.mutex.RUnlock()
+	if durationHist == nil {
+		return
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("method", ctx.Request.Method),
+		attribute.String("route", route),
+		attribute.Int("status_code", al.Status),
+	)
+	durationHist.Record(ctx.Request.Context(), float64(al.Duration.Milliseconds()), attrs)
+	reqSizeHist.Record(ctx.Request.Context(), al.ReqBodySize, attrs)
+	respSizeHist.Record(ctx.Request.Context(), int64(al.RespSize), attrs)
+}
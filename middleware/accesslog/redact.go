@@ -0,0 +1,101 @@
+package accesslog
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Redactor 用于在body被记录之前对其进行脱敏处理
+type Redactor func(contentType string, body []byte) []byte
+
+// RedactJSONFields 返回一个Redactor，它会解析body为JSON，
+// 将fields中列出的字段（不区分大小写，递归查找所有层级）的值替换为"***"，
+// 对于非JSON格式或解析失败的body，原样返回。
+func RedactJSONFields(fields ...string) Redactor {
+	set := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		set[strings.ToLower(f)] = struct{}{}
+	}
+	return func(contentType string, body []byte) []byte {
+		if !isJSONContentType(contentType) || len(body) == 0 {
+			return body
+		}
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return body
+		}
+		redactJSONValue(data, set)
+		redacted, err := json.Marshal(data)
+		if err != nil {
+			return body
+		}
+		return redacted
+	}
+}
+
+func redactJSONValue(v any, fields map[string]struct{}) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			if _, ok := fields[strings.ToLower(k)]; ok {
+				val[k] = "***"
+				continue
+			}
+			redactJSONValue(child, fields)
+		}
+	case []any:
+		for _, child := range val {
+			redactJSONValue(child, fields)
+		}
+	}
+}
+
+func isJSONContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.Contains(ct, "json")
+}
+
+// matchContentType 判断contentType是否匹配pattern，pattern支持"type/*"形式的通配符。
+func matchContentType(pattern, contentType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	// Content-Type可能携带; charset=utf-8之类的参数，先去掉
+	if idx := strings.IndexByte(contentType, ';'); idx >= 0 {
+		contentType = contentType[:idx]
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(contentType, pattern[:len(pattern)-1])
+	}
+	return pattern == contentType
+}
+
+// decodeContentEncoding 根据Content-Encoding对body进行解压，解压失败时原样返回。
+func decodeContentEncoding(encoding string, body []byte) []byte {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return body
+		}
+		defer r.Close()
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			return body
+		}
+		return decoded
+	case "deflate":
+		r := flate.NewReader(bytes.NewReader(body))
+		defer r.Close()
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			return body
+		}
+		return decoded
+	default:
+		return body
+	}
+}
@@ -0,0 +1,101 @@
+package accesslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactJSONFields(t *testing.T) {
+	redactor := RedactJSONFields("password", "token")
+	body := []byte(`{"username":"alice","password":"hunter2","nested":{"token":"abc","keep":"ok"},"list":[{"password":"x"},{"keep":"y"}]}`)
+
+	got := redactor("application/json", body)
+
+	var decoded map[string]any
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("redacted body is not valid JSON: %v", err)
+	}
+	if decoded["password"] != "***" {
+		t.Errorf("top-level password not redacted: %v", decoded["password"])
+	}
+	if decoded["username"] != "alice" {
+		t.Errorf("unrelated field should be untouched: %v", decoded["username"])
+	}
+	nested := decoded["nested"].(map[string]any)
+	if nested["token"] != "***" {
+		t.Errorf("nested token not redacted: %v", nested["token"])
+	}
+	if nested["keep"] != "ok" {
+		t.Errorf("nested unrelated field should be untouched: %v", nested["keep"])
+	}
+	list := decoded["list"].([]any)
+	if list[0].(map[string]any)["password"] != "***" {
+		t.Errorf("password inside list not redacted: %v", list[0])
+	}
+	if list[1].(map[string]any)["keep"] != "y" {
+		t.Errorf("unrelated list entry should be untouched: %v", list[1])
+	}
+}
+
+func TestRedactJSONFieldsNonJSONPassthrough(t *testing.T) {
+	redactor := RedactJSONFields("password")
+	body := []byte("not json at all")
+	if got := redactor("text/plain", body); string(got) != string(body) {
+		t.Errorf("non-JSON content type should be returned untouched, got %q", got)
+	}
+	if got := redactor("application/json", body); string(got) != string(body) {
+		t.Errorf("invalid JSON should be returned untouched, got %q", got)
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	cases := []struct {
+		pattern, contentType string
+		want                 bool
+	}{
+		{"multipart/*", "multipart/form-data; boundary=x", true},
+		{"multipart/*", "application/json", false},
+		{"application/octet-stream", "application/octet-stream", true},
+		{"application/octet-stream", "application/octet-stream; charset=binary", true},
+		{"image/*", "image/png", true},
+		{"application/json", "APPLICATION/JSON", true},
+	}
+	for _, c := range cases {
+		if got := matchContentType(c.pattern, c.contentType); got != c.want {
+			t.Errorf("matchContentType(%q, %q) = %v, want %v", c.pattern, c.contentType, got, c.want)
+		}
+	}
+}
+
+func TestDecodeContentEncodingGzip(t *testing.T) {
+	want := []byte(`{"hello":"world"}`)
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(want); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+
+	got := decodeContentEncoding("gzip", buf.Bytes())
+	if string(got) != string(want) {
+		t.Errorf("decodeContentEncoding(gzip) = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeContentEncodingTruncatedGzipFallsBack(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(`{"hello":"world, this is a long enough payload to survive truncation"}`))
+	_ = gw.Close()
+
+	truncated := buf.Bytes()[:len(buf.Bytes())/2]
+	got := decodeContentEncoding("gzip", truncated)
+	// 截断的压缩流解不出来，应该原样返回而不是panic或丢数据
+	if string(got) != string(truncated) {
+		t.Errorf("decodeContentEncoding on truncated gzip should fall back to raw bytes")
+	}
+}
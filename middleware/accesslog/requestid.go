@@ -0,0 +1,15 @@
+package accesslog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// generateRequestID 在请求没有携带RequestID请求头时生成一个随机ID用于关联日志
+func generateRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,136 @@
+package accesslog
+
+import (
+	"context"
+	"log/slog"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Sink 是AccessLog的输出目的地，实现者可以把日志写到zap、zerolog、OTEL等后端
+type Sink interface {
+	Write(ctx context.Context, al *AccessLog) error
+}
+
+// zapSink 将AccessLog以结构化字段的形式写入zap.Logger
+type zapSink struct {
+	logger *zap.Logger
+	level  zapcore.Level
+}
+
+// NewZapSink 创建一个基于zap.Logger的Sink，level决定日志输出的级别
+func NewZapSink(logger *zap.Logger, level zapcore.Level) Sink {
+	return &zapSink{logger: logger, level: level}
+}
+
+func (s *zapSink) Write(_ context.Context, al *AccessLog) error {
+	fields := []zap.Field{
+		zap.String("method", al.Method),
+		zap.String("url", al.URL),
+		zap.Int("status", al.Status),
+		zap.Duration("duration", al.Duration),
+		zap.Time("start_time", al.StartTime),
+		zap.String("client_ip", al.ClientIP),
+		zap.String("user_agent", al.UserAgent),
+		zap.String("request_id", al.RequestID),
+		zap.Int("resp_size", al.RespSize),
+		zap.String("referer", al.Referer),
+	}
+	if al.ReqBody != "" {
+		fields = append(fields, zap.String("req_body", al.ReqBody))
+	}
+	if al.RespBody != "" {
+		fields = append(fields, zap.String("resp_body", al.RespBody))
+	}
+	for k, v := range al.Fields {
+		fields = append(fields, zap.Any(k, v))
+	}
+	s.logger.Check(s.level, "access log").Write(fields...)
+	return nil
+}
+
+// slogSink 将AccessLog以结构化字段的形式写入log/slog.Logger
+type slogSink struct {
+	logger *slog.Logger
+}
+
+// NewSlogSink 创建一个基于log/slog.Logger的Sink
+func NewSlogSink(logger *slog.Logger) Sink {
+	return &slogSink{logger: logger}
+}
+
+func (s *slogSink) Write(ctx context.Context, al *AccessLog) error {
+	attrs := []any{
+		"method", al.Method,
+		"url", al.URL,
+		"status", al.Status,
+		"duration", al.Duration,
+		"start_time", al.StartTime,
+		"client_ip", al.ClientIP,
+		"user_agent", al.UserAgent,
+		"request_id", al.RequestID,
+		"resp_size", al.RespSize,
+		"referer", al.Referer,
+	}
+	if al.ReqBody != "" {
+		attrs = append(attrs, "req_body", al.ReqBody)
+	}
+	if al.RespBody != "" {
+		attrs = append(attrs, "resp_body", al.RespBody)
+	}
+	for k, v := range al.Fields {
+		attrs = append(attrs, k, v)
+	}
+	s.logger.InfoContext(ctx, "access log", attrs...)
+	return nil
+}
+
+// asyncSink 把Write异步转发给inner，当inner处理不过来时丢弃日志而不是阻塞请求
+type asyncSink struct {
+	inner   Sink
+	ch      chan *AccessLog
+	dropped *atomic.Int64
+}
+
+// NewAsyncSink 包装inner，通过一个容量为bufSize的channel异步写入，
+// 当channel已满时丢弃本条日志并累加丢弃计数，而不是阻塞调用方
+func NewAsyncSink(inner Sink, bufSize int) *AsyncSink {
+	s := &asyncSink{
+		inner:   inner,
+		ch:      make(chan *AccessLog, bufSize),
+		dropped: atomic.NewInt64(0),
+	}
+	go s.loop()
+	return &AsyncSink{sink: s}
+}
+
+func (s *asyncSink) loop() {
+	for al := range s.ch {
+		_ = s.inner.Write(context.Background(), al)
+	}
+}
+
+func (s *asyncSink) Write(_ context.Context, al *AccessLog) error {
+	select {
+	case s.ch <- al:
+	default:
+		s.dropped.Inc()
+	}
+	return nil
+}
+
+// AsyncSink 是NewAsyncSink返回的句柄，额外暴露Dropped用于监控丢弃数量
+type AsyncSink struct {
+	sink *asyncSink
+}
+
+func (a *AsyncSink) Write(ctx context.Context, al *AccessLog) error {
+	return a.sink.Write(ctx, al)
+}
+
+// Dropped 返回因channel已满而被丢弃的日志条数
+func (a *AsyncSink) Dropped() int64 {
+	return a.sink.dropped.Load()
+}
@@ -0,0 +1,126 @@
+package accesslog
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"go.uber.org/atomic"
+)
+
+// teeReadCloser 包装ctx.Request.Body，把原始字节原样转发给handler，
+// 同时在每次Read时把捕获到的字节缓存进内存，供请求结束后记录到AccessLog.ReqBody。
+// 当decodeContentEncoding关闭时，缓存在maxLength处截断即可；开启时解压前的压缩数据
+// 缓存在decodeCap（maxLength和spillThreshold中较大者）处截断——截断后的压缩流大概率
+// 解不出完整内容，但这只影响预览的可读性，换来的是内存占用有上限，不会因为一个超大的
+// 压缩body把整个进程的内存吃满。
+// 当spillDir非空且捕获的总字节数超过spillThreshold时，完整的body会被写入spillDir下的临时文件，
+// 这样上传大文件时也不需要把整个body都留在内存里。
+type teeReadCloser struct {
+	io.ReadCloser
+
+	buf                   bytes.Buffer
+	maxLength             int64
+	decodeCap             int64
+	total                 int64
+	decodeContentEncoding *atomic.Bool
+
+	spillDir       string
+	spillThreshold int64
+	pending        bytes.Buffer // 落盘前暂存的前缀，用于补全spill文件的开头
+	spillFile      *os.File
+}
+
+func newTeeReadCloser(rc io.ReadCloser, maxLength int64, decodeContentEncoding *atomic.Bool, spillDir string, spillThreshold int64) *teeReadCloser {
+	return &teeReadCloser{
+		ReadCloser:            rc,
+		maxLength:             maxLength,
+		decodeCap:             capLength(maxLength, spillThreshold),
+		decodeContentEncoding: decodeContentEncoding,
+		spillDir:              spillDir,
+		spillThreshold:        spillThreshold,
+	}
+}
+
+// capLength 返回a、b中较大者，用于计算DecodeContentEncoding开启时buf的截断上限：
+// 既不能比maxLength小（否则正常预览都会被提前截断），也要覆盖spillThreshold
+// （否则落盘前的压缩数据会在内存里无限增长）
+func capLength(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.capture(p[:n])
+	}
+	return n, err
+}
+
+func (t *teeReadCloser) capture(data []byte) {
+	limit := t.maxLength
+	if t.decodeContentEncoding.Load() {
+		limit = t.decodeCap
+	}
+	if int64(t.buf.Len()) < limit {
+		remain := limit - int64(t.buf.Len())
+		if remain > int64(len(data)) {
+			remain = int64(len(data))
+		}
+		t.buf.Write(data[:remain])
+	}
+	t.total += int64(len(data))
+
+	if t.spillDir == "" {
+		return
+	}
+	if t.spillFile != nil {
+		_, _ = t.spillFile.Write(data)
+		return
+	}
+	if t.total <= t.spillThreshold {
+		t.pending.Write(data)
+		return
+	}
+	f, err := os.CreateTemp(t.spillDir, "ginx-accesslog-*.body")
+	if err != nil {
+		// 落盘失败时退化为只保留内存里已有的maxLength预览，不中断请求
+		return
+	}
+	t.spillFile = f
+	_, _ = f.Write(t.pending.Bytes())
+	t.pending.Reset()
+	_, _ = f.Write(data)
+}
+
+// finalize 在请求结束、handler不会再读取body之后调用，把捕获到的内容写入al，
+// body/decode/redact的处理方式和响应体保持一致
+func (t *teeReadCloser) finalize(b *Builder, contentType, contentEncoding string, al *AccessLog) {
+	al.ReqBodySize = t.total
+	if t.spillFile != nil {
+		_ = t.spillFile.Close()
+		al.ReqBodySpillPath = t.spillFile.Name()
+		return
+	}
+	body := t.buf.Bytes()
+	if t.decodeContentEncoding.Load() {
+		body = decodeContentEncoding(contentEncoding, body)
+	}
+	if int64(len(body)) > t.maxLength {
+		body = body[:t.maxLength]
+	}
+	al.ReqBody = string(b.redact(contentType, body))
+}
+
+// RemoveSpillFile 删除SpillToDisk落盘产生的临时文件，path取自AccessLog.ReqBodySpillPath。
+// 中间件本身不会自动清理该文件（Sink可能是异步消费的），调用方在确认body已经
+// 不再需要时应调用本函数，或者用独立的TTL清理程序定期扫描spillDir
+func RemoveSpillFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	return os.Remove(path)
+}
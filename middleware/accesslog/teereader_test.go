@@ -0,0 +1,125 @@
+package accesslog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/atomic"
+)
+
+func readAllViaTee(t *testing.T, tee *teeReadCloser) {
+	t.Helper()
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		t.Fatalf("reading through tee: %v", err)
+	}
+}
+
+func TestTeeReadCloserCapsPreviewAtMaxLength(t *testing.T) {
+	body := strings.Repeat("a", 100)
+	tee := newTeeReadCloser(io.NopCloser(strings.NewReader(body)), 10, atomic.NewBool(false), "", 0)
+	readAllViaTee(t, tee)
+
+	al := &AccessLog{}
+	tee.finalize(NewBuilder(nil), "text/plain", "", al)
+
+	if al.ReqBody != body[:10] {
+		t.Errorf("ReqBody = %q, want first 10 bytes %q", al.ReqBody, body[:10])
+	}
+	if al.ReqBodySize != int64(len(body)) {
+		t.Errorf("ReqBodySize = %d, want %d (uncapped total)", al.ReqBodySize, len(body))
+	}
+}
+
+func TestTeeReadCloserForwardsFullBodyToHandler(t *testing.T) {
+	body := strings.Repeat("b", 100)
+	tee := newTeeReadCloser(io.NopCloser(strings.NewReader(body)), 10, atomic.NewBool(false), "", 0)
+
+	got, err := io.ReadAll(tee)
+	if err != nil {
+		t.Fatalf("reading through tee: %v", err)
+	}
+	if string(got) != body {
+		t.Errorf("handler should see the full, untruncated body regardless of maxLength")
+	}
+}
+
+func TestTeeReadCloserSpillsToDiskPastThreshold(t *testing.T) {
+	dir := t.TempDir()
+	body := strings.Repeat("c", 100)
+	tee := newTeeReadCloser(io.NopCloser(strings.NewReader(body)), 10, atomic.NewBool(false), dir, 20)
+	readAllViaTee(t, tee)
+
+	al := &AccessLog{}
+	tee.finalize(NewBuilder(nil), "text/plain", "", al)
+
+	if al.ReqBodySpillPath == "" {
+		t.Fatal("expected ReqBodySpillPath to be set once total exceeds threshold")
+	}
+	if filepath.Dir(al.ReqBodySpillPath) != dir {
+		t.Errorf("spill file should live under %q, got %q", dir, al.ReqBodySpillPath)
+	}
+	if al.ReqBody != "" {
+		t.Errorf("ReqBody should be empty when the body was spilled to disk, got %q", al.ReqBody)
+	}
+
+	defer os.Remove(al.ReqBodySpillPath)
+	spilled, err := os.ReadFile(al.ReqBodySpillPath)
+	if err != nil {
+		t.Fatalf("reading spill file: %v", err)
+	}
+	if string(spilled) != body {
+		t.Errorf("spill file should contain the full original body (including the pre-threshold prefix), got %q", spilled)
+	}
+}
+
+func TestTeeReadCloserBelowThresholdDoesNotSpill(t *testing.T) {
+	dir := t.TempDir()
+	body := strings.Repeat("d", 5)
+	tee := newTeeReadCloser(io.NopCloser(strings.NewReader(body)), 10, atomic.NewBool(false), dir, 20)
+	readAllViaTee(t, tee)
+
+	al := &AccessLog{}
+	tee.finalize(NewBuilder(nil), "text/plain", "", al)
+
+	if al.ReqBodySpillPath != "" {
+		t.Errorf("body under threshold should not be spilled, got path %q", al.ReqBodySpillPath)
+	}
+	if al.ReqBody != body {
+		t.Errorf("ReqBody = %q, want %q", al.ReqBody, body)
+	}
+}
+
+func TestTeeReadCloserDecodeContentEncodingBoundsBuffer(t *testing.T) {
+	body := strings.Repeat("e", 1000)
+	tee := newTeeReadCloser(io.NopCloser(strings.NewReader(body)), 10, atomic.NewBool(true), "", 50)
+	readAllViaTee(t, tee)
+
+	if tee.buf.Len() > 50 {
+		t.Errorf("buf.Len() = %d, want capped at max(maxLength, spillThreshold) = 50 even with DecodeContentEncoding on", tee.buf.Len())
+	}
+	if tee.total != int64(len(body)) {
+		t.Errorf("total = %d, want %d (uncapped, used for ReqBodySize)", tee.total, len(body))
+	}
+}
+
+func TestRemoveSpillFile(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.CreateTemp(dir, "spill-*.body")
+	if err != nil {
+		t.Fatalf("create temp file: %v", err)
+	}
+	_ = f.Close()
+
+	if err := RemoveSpillFile(f.Name()); err != nil {
+		t.Fatalf("RemoveSpillFile: %v", err)
+	}
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected spill file to be removed")
+	}
+	if err := RemoveSpillFile(""); err != nil {
+		t.Errorf("RemoveSpillFile(\"\") should be a no-op, got %v", err)
+	}
+}